@@ -0,0 +1,203 @@
+// Package filestore stores sessions as per-session files on disk. It is
+// meant for local development, where running memcached/redis/a SQL server
+// just to poke at session behavior is overkill.
+package filestore
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/miaomiao3/session"
+)
+
+func init() {
+	sessions.Register("file", func(config json.RawMessage) (sessions.Store, error) {
+		var cfg Config
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, err
+		}
+		return NewFileStore(cfg)
+	})
+}
+
+// Config configures a FileStore, decoded from the JSON blob passed to
+// sessions.NewManager("file", cfg).
+type Config struct {
+	Dir       string   `json:"dir"` // if empty, a temp directory is created
+	MaxAge    int      `json:"maxAge"`
+	MaxLength int      `json:"maxLength"`
+	KeyPairs  [][]byte `json:"keyPairs"`
+}
+
+// FileStore stores sessions as one file per session under Dir, guarded by
+// a single mutex since it's only meant for single-process dev use.
+type FileStore struct {
+	Codecs        []securecookie.Codec
+	DefaultMaxAge int
+	Dir           string
+	options       *gsessions.Options
+	maxLength     int
+	mu            sync.Mutex
+}
+
+// NewFileStore returns a new FileStore. If cfg.Dir is empty, a temp
+// directory is created with ioutil.TempDir.
+func NewFileStore(cfg Config) (*FileStore, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		var err error
+		dir, err = ioutil.TempDir("", "sessions_")
+		if err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	maxLength := cfg.MaxLength
+	if maxLength == 0 {
+		maxLength = 4096
+	}
+	store := &FileStore{
+		Codecs: securecookie.CodecsFromPairs(cfg.KeyPairs...),
+		options: &gsessions.Options{
+			Path:   "/",
+			MaxAge: cfg.MaxAge,
+		},
+		DefaultMaxAge: 60 * 30, // 30 minutes seems like a reasonable default
+		Dir:           dir,
+		maxLength:     maxLength,
+	}
+	return store, nil
+}
+
+// Options sets the configuration for a session.
+func (s *FileStore) Options(options sessions.Options) {
+	s.options = &gsessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *FileStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *FileStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	var err error
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			var found bool
+			found, err = s.load(session)
+			session.IsNew = !(err == nil && found)
+		}
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *FileStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(session); err != nil {
+			return err
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.Dir, "session_"+id)
+}
+
+// save writes the session to its file.
+func (s *FileStore) save(session *gsessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(encoded) > s.maxLength {
+		return errors.New("filestore: the value to store is too big")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ioutil.WriteFile(s.path(session.ID), []byte(encoded), 0600)
+}
+
+// load reads the session from its file. It reports false, with a nil error,
+// when the session has no file or its file has expired.
+func (s *FileStore) load(session *gsessions.Session) (bool, error) {
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+
+	s.mu.Lock()
+	fi, statErr := os.Stat(s.path(session.ID))
+	if statErr != nil {
+		s.mu.Unlock()
+		if os.IsNotExist(statErr) {
+			return false, nil // no data was associated with this key
+		}
+		return false, statErr
+	}
+	if age > 0 && time.Since(fi.ModTime()) > time.Duration(age)*time.Second {
+		s.mu.Unlock()
+		return false, nil // expired, treat as no data
+	}
+	data, err := ioutil.ReadFile(s.path(session.ID))
+	s.mu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, securecookie.DecodeMulti(session.Name(), string(data), &session.Values, s.Codecs...)
+}
+
+// delete removes the session's file.
+func (s *FileStore) delete(session *gsessions.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(session.ID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package filestore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func newTestStore(t *testing.T) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(Config{
+		Dir:      t.TempDir(),
+		KeyPairs: [][]byte{securecookie.GenerateRandomKey(32)},
+	})
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return store
+}
+
+func TestFileStoreSaveLoadRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	session, err := store.New(req, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !session.IsNew {
+		t.Fatal("New session should be IsNew")
+	}
+	session.Values["user"] = "alice"
+
+	rec := httptest.NewRecorder()
+	if err := store.Save(req, rec, session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+
+	req2 := httptest.NewRequest(http.MethodGet, "/", nil)
+	req2.AddCookie(cookies[0])
+	loaded, err := store.New(req2, "test")
+	if err != nil {
+		t.Fatalf("New (reload): %v", err)
+	}
+	if loaded.IsNew {
+		t.Fatal("reloaded session should not be IsNew")
+	}
+	if loaded.Values["user"] != "alice" {
+		t.Fatalf("Values[user] = %v, want alice", loaded.Values["user"])
+	}
+}
+
+func TestFileStoreDelete(t *testing.T) {
+	store := newTestStore(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	session, _ := store.New(req, "test")
+	session.Values["user"] = "alice"
+
+	rec := httptest.NewRecorder()
+	if err := store.Save(req, rec, session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+
+	req2 := httptest.NewRequest(http.MethodGet, "/", nil)
+	req2.AddCookie(cookies[0])
+	loaded, _ := store.New(req2, "test")
+	loaded.Options.MaxAge = -1
+
+	rec2 := httptest.NewRecorder()
+	if err := store.Save(req2, rec2, loaded); err != nil {
+		t.Fatalf("Save (delete): %v", err)
+	}
+
+	req3 := httptest.NewRequest(http.MethodGet, "/", nil)
+	req3.AddCookie(cookies[0])
+	reloaded, err := store.New(req3, "test")
+	if err != nil {
+		t.Fatalf("New (after delete): %v", err)
+	}
+	if !reloaded.IsNew {
+		t.Fatal("session should look new after delete")
+	}
+}
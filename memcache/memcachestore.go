@@ -0,0 +1,183 @@
+package memcachestore
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/miaomiao3/session"
+)
+
+func init() {
+	sessions.Register("memcache", func(config json.RawMessage) (sessions.Store, error) {
+		var cfg Config
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, err
+		}
+		return NewMemcacheStore(cfg)
+	})
+}
+
+// Config configures a MemcacheStore, decoded from the JSON blob passed to
+// sessions.NewManager("memcache", cfg).
+type Config struct {
+	Addrs     []string `json:"addrs"`
+	KeyPrefix string   `json:"keyPrefix"`
+	MaxAge    int      `json:"maxAge"`
+	MaxLength int      `json:"maxLength"`
+	KeyPairs  [][]byte `json:"keyPairs"`
+}
+
+// MemcacheStore stores sessions in memcached via bradfitz/gomemcache.
+type MemcacheStore struct {
+	Client        *memcache.Client
+	Codecs        []securecookie.Codec
+	DefaultMaxAge int // default memcache TTL for a MaxAge == 0 session
+	options       *gsessions.Options
+	maxLength     int
+	keyPrefix     string
+}
+
+// NewMemcacheStore returns a new MemcacheStore.
+func NewMemcacheStore(cfg Config) (*MemcacheStore, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("memcachestore: at least one address is required")
+	}
+	keyPrefix := cfg.KeyPrefix
+	if keyPrefix == "" {
+		keyPrefix = "session_"
+	}
+	maxLength := cfg.MaxLength
+	if maxLength == 0 {
+		maxLength = 4096
+	}
+	store := &MemcacheStore{
+		Client: memcache.New(cfg.Addrs...),
+		Codecs: securecookie.CodecsFromPairs(cfg.KeyPairs...),
+		options: &gsessions.Options{
+			Path:   "/",
+			MaxAge: cfg.MaxAge,
+		},
+		DefaultMaxAge: 60 * 30, // 30 minutes seems like a reasonable default
+		maxLength:     maxLength,
+		keyPrefix:     keyPrefix,
+	}
+	return store, nil
+}
+
+// SetMaxLength sets MemcacheStore.maxLength if l is greater than or equal to 0.
+// If l is 0 there is no limit to the size of a session, use with caution.
+func (s *MemcacheStore) SetMaxLength(l int) {
+	if l >= 0 {
+		s.maxLength = l
+	}
+}
+
+// SetKeyPrefix sets the prefix used for memcache keys.
+func (s *MemcacheStore) SetKeyPrefix(p string) {
+	s.keyPrefix = p
+}
+
+// Options sets the configuration for a session.
+func (s *MemcacheStore) Options(options sessions.Options) {
+	s.options = &gsessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *MemcacheStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *MemcacheStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	var err error
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			err = s.load(session)
+			session.IsNew = !(err == nil)
+		}
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *MemcacheStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(session); err != nil {
+			return err
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// save stores the session in memcached.
+func (s *MemcacheStore) save(session *gsessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(encoded) > s.maxLength {
+		return errors.New("memcachestore: the value to store is too big")
+	}
+
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	return s.Client.Set(&memcache.Item{
+		Key:        s.keyPrefix + session.ID,
+		Value:      []byte(encoded),
+		Expiration: int32(age),
+	})
+}
+
+// load reads the session from memcached.
+func (s *MemcacheStore) load(session *gsessions.Session) error {
+	item, err := s.Client.Get(s.keyPrefix + session.ID)
+	if err == memcache.ErrCacheMiss {
+		return nil // no data was associated with this key
+	}
+	if err != nil {
+		return err
+	}
+	return securecookie.DecodeMulti(session.Name(), string(item.Value), &session.Values, s.Codecs...)
+}
+
+// delete removes the key from memcached.
+func (s *MemcacheStore) delete(session *gsessions.Session) error {
+	err := s.Client.Delete(s.keyPrefix + session.ID)
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
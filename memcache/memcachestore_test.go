@@ -0,0 +1,45 @@
+package memcachestore
+
+import "testing"
+
+func TestNewMemcacheStoreRequiresAddrs(t *testing.T) {
+	if _, err := NewMemcacheStore(Config{}); err == nil {
+		t.Fatal("NewMemcacheStore succeeded with no addresses")
+	}
+}
+
+func TestNewMemcacheStoreDefaults(t *testing.T) {
+	store, err := NewMemcacheStore(Config{Addrs: []string{"127.0.0.1:11211"}})
+	if err != nil {
+		t.Fatalf("NewMemcacheStore: %v", err)
+	}
+	if store.keyPrefix != "session_" {
+		t.Fatalf("keyPrefix = %q, want %q", store.keyPrefix, "session_")
+	}
+	if store.maxLength != 4096 {
+		t.Fatalf("maxLength = %d, want 4096", store.maxLength)
+	}
+}
+
+func TestMemcacheStoreSetters(t *testing.T) {
+	store, err := NewMemcacheStore(Config{Addrs: []string{"127.0.0.1:11211"}})
+	if err != nil {
+		t.Fatalf("NewMemcacheStore: %v", err)
+	}
+
+	store.SetKeyPrefix("other_")
+	if store.keyPrefix != "other_" {
+		t.Fatalf("keyPrefix = %q, want %q", store.keyPrefix, "other_")
+	}
+
+	store.SetMaxLength(1024)
+	if store.maxLength != 1024 {
+		t.Fatalf("maxLength = %d, want 1024", store.maxLength)
+	}
+
+	// Negative values are ignored, per SetMaxLength's doc comment.
+	store.SetMaxLength(-1)
+	if store.maxLength != 1024 {
+		t.Fatalf("maxLength after negative SetMaxLength = %d, want unchanged 1024", store.maxLength)
+	}
+}
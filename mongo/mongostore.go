@@ -5,13 +5,16 @@
 package mongostore
 
 import (
+	"encoding/base64"
 	"errors"
+	"net/http"
+	"time"
+
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	"github.com/miaomiao3/session/ticket"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-	"net/http"
-	"time"
 )
 
 var (
@@ -36,6 +39,32 @@ type MongoStore struct {
 	Codecs           []securecookie.Codec
 	Options          *sessions.Options
 	GlobalMgoSession *mgo.Session
+
+	ticketEncryption bool
+	// secrets stashes the per-session AES key between New() (where it is
+	// parsed out of the ticket cookie) and the Save() call that ends the
+	// same request. See ticket.SecretStash for why entries aren't consumed.
+	secrets *ticket.SecretStash
+
+	// serializer turns session.Values into bytes before they are encrypted
+	// (ticket mode) or handed to securecookie (legacy mode). Defaults to
+	// ticket.GobSerializer; override with SetSerializer.
+	serializer ticket.Serializer
+}
+
+// SetSerializer overrides the default ticket.GobSerializer.
+func (m *MongoStore) SetSerializer(ser ticket.Serializer) {
+	m.serializer = ser
+}
+
+// EnableTicketEncryption turns on ticket-based encrypted payloads: the
+// session's Values are encrypted with a per-session secret that travels in
+// the cookie, and only the ciphertext is stored in MongoDB. Existing
+// sessions written in the legacy (plaintext-ID cookie) format are still
+// readable; they get upgraded to the new format the next time they are
+// saved.
+func (m *MongoStore) EnableTicketEncryption(enable bool) {
+	m.ticketEncryption = enable
 }
 
 // NewMongoStore returns a new MongoStore.
@@ -48,7 +77,9 @@ keyPairs ...[]byte) *MongoStore {
 			Path: "/",
 			MaxAge: maxAge,
 		},
-		GlobalMgoSession:  globalMgoSession,
+		GlobalMgoSession: globalMgoSession,
+		secrets:          ticket.NewSecretStash(),
+		serializer:       ticket.GobSerializer{},
 	}
 	globalMgoSession.SetMode(mgo.Monotonic, true)
 	//default is 4096
@@ -92,9 +123,29 @@ func (m *MongoStore) New(r *http.Request, name string) (
 	var err error
 	if cookie, err := r.Cookie(name); err == nil {
 		cookieVal := cookie.Value
+		if m.ticketEncryption {
+			var t ticket.Ticket
+			if err = securecookie.DecodeMulti(name, cookieVal, &t, m.Codecs...); err == nil {
+				session.ID = t.ID
+				var secret []byte
+				if secret, err = base64.StdEncoding.DecodeString(t.Secret); err == nil {
+					m.secrets.Stash(session.ID, secret)
+					if err = m.load(session, secret); err == nil {
+						session.IsNew = false
+					} else {
+						err = nil
+					}
+				}
+				return session, err
+			}
+			// Fall back to the legacy plaintext-ID cookie format below, so
+			// sessions written before ticket encryption was enabled keep
+			// working; they are upgraded to a ticket the next time they
+			// are saved.
+		}
 		err = securecookie.DecodeMulti(name, cookieVal, &session.ID, m.Codecs...)
 		if err == nil {
-			err = m.load(session)
+			err = m.load(session, nil)
 			if err == nil {
 				session.IsNew = false
 			} else {
@@ -120,7 +171,30 @@ session *sessions.Session) error {
 		session.ID = bson.NewObjectId().Hex()
 	}
 
-	if err := m.upsert(session); err != nil {
+	if m.ticketEncryption {
+		secret, ok := m.secrets.Get(session.ID)
+		if !ok {
+			secret = securecookie.GenerateRandomKey(32)
+		}
+		// Refresh rather than consume: a concurrent request carrying the
+		// same ticket cookie must see this same secret, not mint its own
+		// (see ticket.SecretStash).
+		m.secrets.Stash(session.ID, secret)
+		if err := m.upsert(session, secret); err != nil {
+			return err
+		}
+		encoded, err := securecookie.EncodeMulti(session.Name(), ticket.Ticket{
+			ID:     session.ID,
+			Secret: base64.StdEncoding.EncodeToString(secret),
+		}, m.Codecs...)
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		return nil
+	}
+
+	if err := m.upsert(session, nil); err != nil {
 		return err
 	}
 
@@ -133,7 +207,7 @@ session *sessions.Session) error {
 	return nil
 }
 
-func (m *MongoStore) load(session *sessions.Session) error {
+func (m *MongoStore) load(session *sessions.Session, secret []byte) error {
 	if !bson.IsObjectIdHex(session.ID) {
 		return ErrInvalidId
 	}
@@ -148,15 +222,28 @@ func (m *MongoStore) load(session *sessions.Session) error {
 		return err
 	}
 
-	if err := securecookie.DecodeMulti(session.Name(), s.Data, &session.Values,
+	if secret != nil {
+		plain, err := ticket.Decrypt(secret, s.Data)
+		if err != nil {
+			return err
+		}
+		return m.serializer.Deserialize(plain, session)
+	}
+
+	var plain []byte
+	if err := securecookie.DecodeMulti(session.Name(), s.Data, &plain,
 		m.Codecs...); err != nil {
 		return err
 	}
 
-	return nil
+	return m.serializer.Deserialize(plain, session)
 }
 
-func (m *MongoStore) upsert(session *sessions.Session) error {
+// upsert stores the session in MongoDB. When secret is non-nil,
+// session.Values is AES-GCM encrypted with it instead of going through
+// m.Codecs, so that reading the stored document alone (without the cookie)
+// does not disclose it.
+func (m *MongoStore) upsert(session *sessions.Session, secret []byte) error {
 	if !bson.IsObjectIdHex(session.ID) {
 		return ErrInvalidId
 	}
@@ -171,10 +258,25 @@ func (m *MongoStore) upsert(session *sessions.Session) error {
 		modified = time.Now()
 	}
 
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values,
-		m.Codecs...)
-	if err != nil {
-		return err
+	var encoded string
+	var err error
+	if secret != nil {
+		var plain []byte
+		if plain, err = m.serializer.Serialize(session); err != nil {
+			return err
+		}
+		if encoded, err = ticket.Encrypt(secret, plain); err != nil {
+			return err
+		}
+	} else {
+		var plain []byte
+		if plain, err = m.serializer.Serialize(session); err != nil {
+			return err
+		}
+		if encoded, err = securecookie.EncodeMulti(session.Name(), plain,
+			m.Codecs...); err != nil {
+			return err
+		}
 	}
 
 	s := SessionItem{
@@ -196,6 +298,8 @@ func (m *MongoStore) upsert(session *sessions.Session) error {
 }
 
 func (m *MongoStore) delete(session *sessions.Session) error {
+	defer m.secrets.Forget(session.ID)
+
 	if !bson.IsObjectIdHex(session.ID) {
 		return ErrInvalidId
 	}
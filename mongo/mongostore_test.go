@@ -0,0 +1,24 @@
+package mongostore
+
+import (
+	"testing"
+
+	"github.com/miaomiao3/session/ticket"
+)
+
+// The AES-GCM encrypt/decrypt and Serializer round-trip tests now live in
+// ticket/ticket_test.go, since MongoStore just delegates to that package.
+// This only checks the wiring: a MongoStore holding ticket.GobSerializer, the
+// serializer NewMongoStore sets, has it swapped by SetSerializer. The store is
+// built by hand, so NewMongoStore itself (which needs MongoDB) is not run.
+func TestMongoStoreDefaultSerializer(t *testing.T) {
+	m := &MongoStore{serializer: ticket.GobSerializer{}}
+	if _, ok := m.serializer.(ticket.GobSerializer); !ok {
+		t.Fatalf("default serializer = %T, want ticket.GobSerializer", m.serializer)
+	}
+
+	m.SetSerializer(ticket.JSONSerializer{})
+	if _, ok := m.serializer.(ticket.JSONSerializer); !ok {
+		t.Fatalf("serializer after SetSerializer = %T, want ticket.JSONSerializer", m.serializer)
+	}
+}
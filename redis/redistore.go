@@ -6,19 +6,33 @@ package redistore
 
 import (
 	"encoding/base32"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/go-redis/redis"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
-	"github.com/go-redis/redis"
+	"github.com/miaomiao3/session/ticket"
 )
 
 // Amount of time for cookies/redis keys to expire.
 var sessionExpire = 86400 * 30
 
+// Mode selects how a RediStore talks to its redis deployment.
+type Mode int
+
+const (
+	ModeSingle Mode = iota
+	ModeCluster
+	ModeSentinel
+)
+
 // RediStore stores sessions in a redis backend.
 type RediStore struct {
 	Client        *redis.Client
@@ -28,7 +42,69 @@ type RediStore struct {
 	DefaultMaxAge int               // default Redis TTL for a MaxAge == 0 session
 	maxLength     int
 	keyPrefix     string
-	IsCluster     bool
+	IsCluster     bool // selects ClusterClient over Client for every redis call
+	Mode          Mode // records which kind of deployment the store was built for
+
+	// ReplicaClients, if non-empty, are read-only connections that load()
+	// round-robins across instead of hitting Client/ClusterClient. save()
+	// and delete() always go to the master. Only used outside cluster mode.
+	ReplicaClients []*redis.Client
+	replicaCursor  uint64
+
+	// localCache holds recently seen raw (pre-decode) session payloads
+	// keyed by session ID, so repeated Get calls within the same request —
+	// or tight back-to-back requests from the same user — don't all hit
+	// redis. Entries are short-lived (CacheTTL) and kept up to date by
+	// save()/delete(); DisableLocalCache turns the whole thing off.
+	localCache    sync.Map // map[string]cacheEntry
+	CacheTTL      time.Duration
+	cacheDisabled bool
+
+	ticketEncryption bool
+	// secrets stashes the per-session AES key between New() (where it is
+	// parsed out of the ticket cookie) and the Save() call that ends the
+	// same request. See ticket.SecretStash for why entries aren't consumed.
+	secrets *ticket.SecretStash
+
+	// serializer turns session.Values into bytes before they are encrypted
+	// (ticket mode) or handed to securecookie (legacy mode). Defaults to
+	// ticket.GobSerializer; override with SetSerializer.
+	serializer ticket.Serializer
+}
+
+// RedisConfig configures NewRediStoreWithOptions. Exactly one of IsCluster
+// or the Sentinel fields (MasterName + SentinelAddrs) should be set; if
+// neither is, a single-node client is built from Address[0].
+type RedisConfig struct {
+	IsCluster bool
+	Address   []string
+	Password  string
+	Size      int // maximum number of idle connections
+	KeyPairs  [][]byte
+
+	// Sentinel configuration. Setting MasterName and SentinelAddrs builds
+	// the client via redis.NewFailoverClient for automatic master failover.
+	MasterName       string
+	SentinelAddrs    []string
+	SentinelPassword string
+
+	// ReplicaAddrs, if set, are dialed as read-only connections for load().
+	ReplicaAddrs    []string
+	ReplicaPassword string
+}
+
+// EnableTicketEncryption turns on ticket-based encrypted payloads: the
+// session's Values are encrypted with a per-session secret that travels in
+// the cookie, and only the ciphertext is stored in Redis. Existing sessions
+// written in the legacy (plaintext-ID cookie) format are still readable;
+// they get upgraded to the new format the next time they are saved.
+func (s *RediStore) EnableTicketEncryption(enable bool) {
+	s.ticketEncryption = enable
+}
+
+// SetSerializer overrides the default ticket.GobSerializer.
+func (s *RediStore) SetSerializer(ser ticket.Serializer) {
+	s.serializer = ser
 }
 
 // SetMaxLength sets RediStore.maxLength if the `l` argument is greater or equal 0
@@ -52,7 +128,8 @@ func (s *RediStore) SetKeyPrefix(p string) {
 // both in database and a browser. This is to change session storage configuration.
 // If you want just to remove session use your session `s` object and change it's
 // `Options.MaxAge` to -1, as specified in
-//    http://godoc.org/github.com/gorilla/sessions#Options
+//
+//	http://godoc.org/github.com/gorilla/sessions#Options
 //
 // Default is the one provided by this package value - `sessionExpire`.
 // Set it to 0 for no restriction.
@@ -97,6 +174,9 @@ func NewRediStore(isCluster bool, size int, address []string, password string, k
 			maxLength:     4096,
 			keyPrefix:     "session_",
 			IsCluster:     true,
+			Mode:          ModeCluster,
+			secrets:       ticket.NewSecretStash(),
+			serializer:    ticket.GobSerializer{},
 		}
 	} else {
 		if len(address) > 1 {
@@ -119,15 +199,227 @@ func NewRediStore(isCluster bool, size int, address []string, password string, k
 			maxLength:     4096,
 			keyPrefix:     "session_",
 			IsCluster:     false,
+			Mode:          ModeSingle,
+			secrets:       ticket.NewSecretStash(),
+			serializer:    ticket.GobSerializer{},
+		}
+	}
+
+	_, err := rs.ping()
+	return rs, err
+}
+
+// NewRediStoreWithOptions returns a new RediStore built from cfg, supporting
+// single, cluster, and Sentinel-backed (automatic master failover) redis
+// deployments, plus an optional set of read-only replicas for load().
+func NewRediStoreWithOptions(cfg RedisConfig) (*RediStore, error) {
+	rs := &RediStore{
+		Codecs: securecookie.CodecsFromPairs(cfg.KeyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: sessionExpire,
+		},
+		DefaultMaxAge: 60 * 30, // 30 minutes seems like a reasonable default
+		maxLength:     4096,
+		keyPrefix:     "session_",
+		secrets:       ticket.NewSecretStash(),
+		serializer:    ticket.GobSerializer{},
+	}
+
+	switch {
+	case cfg.MasterName != "" && len(cfg.SentinelAddrs) > 0:
+		if cfg.SentinelPassword != "" {
+			// go-redis v6's FailoverOptions has no SentinelPassword field
+			// (that lands in v7), so there is no way to honor this short of
+			// silently connecting to the Sentinels unauthenticated. Fail
+			// loudly instead of doing that.
+			return nil, errors.New("redistore: SentinelPassword requires go-redis v7+; this package is built against v6")
+		}
+		rs.Client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: cfg.SentinelAddrs,
+			Password:      cfg.Password,
+			PoolSize:      cfg.Size,
+			DialTimeout:   10 * time.Second,
+		})
+		rs.Mode = ModeSentinel
+	case cfg.IsCluster:
+		if len(cfg.Address) < 6 {
+			panic("cluster mode. redis cluster address error. count < 6")
+		}
+		rs.ClusterClient = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:       cfg.Address,
+			PoolSize:    cfg.Size,
+			DialTimeout: 10 * time.Second,
+			Password:    cfg.Password,
+		})
+		rs.IsCluster = true
+		rs.Mode = ModeCluster
+	default:
+		if len(cfg.Address) != 1 {
+			panic("single mode. redis address error. count != 1")
 		}
+		rs.Client = redis.NewClient(&redis.Options{
+			Addr:        cfg.Address[0],
+			PoolSize:    cfg.Size,
+			DialTimeout: 10 * time.Second,
+			Password:    cfg.Password,
+		})
+		rs.Mode = ModeSingle
+	}
+
+	for _, addr := range cfg.ReplicaAddrs {
+		rs.ReplicaClients = append(rs.ReplicaClients, redis.NewClient(&redis.Options{
+			Addr:        addr,
+			PoolSize:    cfg.Size,
+			DialTimeout: 10 * time.Second,
+			Password:    cfg.ReplicaPassword,
+		}))
 	}
 
 	_, err := rs.ping()
 	return rs, err
 }
 
-// Close closes the underlying *redis.Pool
+// readClient returns the client load() should use: the next replica in the
+// round-robin if any are configured, otherwise the master client.
+func (s *RediStore) readClient() *redis.Client {
+	if len(s.ReplicaClients) == 0 {
+		return s.Client
+	}
+	i := atomic.AddUint64(&s.replicaCursor, 1)
+	return s.ReplicaClients[i%uint64(len(s.ReplicaClients))]
+}
+
+// cacheEntry is a cached raw (pre-decode/decrypt) session payload.
+type cacheEntry struct {
+	data    string
+	expires time.Time
+}
+
+// DisableLocalCache turns off the in-process cache; load() will always hit
+// redis (or a replica) directly.
+func (s *RediStore) DisableLocalCache() {
+	s.cacheDisabled = true
+}
+
+func (s *RediStore) cacheGet(id string) (string, bool) {
+	if s.cacheDisabled || id == "" {
+		return "", false
+	}
+	v, ok := s.localCache.Load(id)
+	if !ok {
+		return "", false
+	}
+	entry := v.(cacheEntry)
+	if time.Now().After(entry.expires) {
+		s.localCache.Delete(id)
+		return "", false
+	}
+	return entry.data, true
+}
+
+func (s *RediStore) cacheStore(id, data string) {
+	if s.cacheDisabled || id == "" {
+		return
+	}
+	ttl := s.CacheTTL
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	s.localCache.Store(id, cacheEntry{data: data, expires: time.Now().Add(ttl)})
+}
+
+func (s *RediStore) cacheDelete(id string) {
+	s.localCache.Delete(id)
+}
+
+// pipeliner returns the Pipeliner for whichever client backs this store.
+func (s *RediStore) pipeliner() redis.Pipeliner {
+	if s.IsCluster {
+		return s.ClusterClient.Pipeline()
+	}
+	return s.Client.Pipeline()
+}
+
+// SaveBatch writes multiple sessions in a single pipelined round trip to
+// redis instead of the one round trip per session that calling Save on
+// each individually would cost — useful for requests that touch more than
+// one gorilla session (e.g. a flash session alongside the main one).
+// SaveBatch does not support ticket encryption.
+func (s *RediStore) SaveBatch(w http.ResponseWriter, sessionList ...*sessions.Session) error {
+	if len(sessionList) == 0 {
+		return nil
+	}
+	if s.ticketEncryption {
+		return errors.New("redistore: SaveBatch does not support ticket encryption")
+	}
+
+	pipe := s.pipeliner()
+	type pendingSave struct {
+		session *sessions.Session
+		encoded string
+	}
+	var toSave []pendingSave
+	var toDelete []*sessions.Session
+
+	for _, session := range sessionList {
+		if session.Options.MaxAge < 0 {
+			pipe.Del(s.keyPrefix + session.ID)
+			toDelete = append(toDelete, session)
+			continue
+		}
+
+		if session.ID == "" {
+			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		}
+		plain, err := s.serializer.Serialize(session)
+		if err != nil {
+			return err
+		}
+		encoded, err := securecookie.EncodeMulti(session.Name(), plain, s.Codecs...)
+		if err != nil {
+			return err
+		}
+		if s.maxLength != 0 && len(encoded) > s.maxLength {
+			return errors.New("SessionStore: the value to store is too big")
+		}
+		age := session.Options.MaxAge
+		if age == 0 {
+			age = s.DefaultMaxAge
+		}
+		pipe.Set(s.keyPrefix+session.ID, encoded, time.Duration(age)*time.Second)
+		toSave = append(toSave, pendingSave{session, encoded})
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return err
+	}
+
+	for _, p := range toSave {
+		s.cacheStore(p.session.ID, p.encoded)
+		cookieVal, err := securecookie.EncodeMulti(p.session.Name(), p.session.ID, s.Codecs...)
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(p.session.Name(), cookieVal, p.session.Options))
+	}
+	for _, session := range toDelete {
+		s.cacheDelete(session.ID)
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+	}
+	return nil
+}
+
+// Close closes the underlying redis client, including any replica
+// connections.
 func (s *RediStore) Close() error {
+	for _, c := range s.ReplicaClients {
+		c.Close()
+	}
+	if s.IsCluster {
+		return s.ClusterClient.Close()
+	}
 	return s.Client.Close()
 }
 
@@ -149,9 +441,26 @@ func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error)
 	session.Options = &options
 	session.IsNew = true
 	if c, errCookie := r.Cookie(name); errCookie == nil {
+		if s.ticketEncryption {
+			var t ticket.Ticket
+			if err = securecookie.DecodeMulti(name, c.Value, &t, s.Codecs...); err == nil {
+				session.ID = t.ID
+				var secret []byte
+				if secret, err = base64.StdEncoding.DecodeString(t.Secret); err == nil {
+					s.secrets.Stash(session.ID, secret)
+					err = s.load(session, secret)
+					session.IsNew = !(err == nil)
+				}
+				return session, err
+			}
+			// Fall back to the legacy plaintext-ID cookie format below, so
+			// sessions written before ticket encryption was enabled keep
+			// working; they are upgraded to a ticket the next time they
+			// are saved.
+		}
 		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
 		if err == nil {
-			err = s.load(session)
+			err = s.load(session, nil)
 			session.IsNew = !(err == nil) // not new if no error and data available
 		}
 	}
@@ -166,21 +475,46 @@ func (s *RediStore) Save(r *http.Request, w http.ResponseWriter, session *sessio
 			return err
 		}
 		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
-	} else {
-		// Build an alphanumeric key for the redis store.
-		// generate the session id
-		if session.ID == "" {
-			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		return nil
+	}
+
+	// Build an alphanumeric key for the redis store.
+	// generate the session id
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+
+	if s.ticketEncryption {
+		secret, ok := s.secrets.Get(session.ID)
+		if !ok {
+			secret = securecookie.GenerateRandomKey(32)
 		}
-		if err := s.save(session); err != nil {
+		// Refresh rather than consume: a concurrent request carrying the
+		// same ticket cookie must see this same secret, not mint its own
+		// (see ticket.SecretStash).
+		s.secrets.Stash(session.ID, secret)
+		if err := s.save(session, secret); err != nil {
 			return err
 		}
-		encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+		encoded, err := securecookie.EncodeMulti(session.Name(), ticket.Ticket{
+			ID:     session.ID,
+			Secret: base64.StdEncoding.EncodeToString(secret),
+		}, s.Codecs...)
 		if err != nil {
 			return err
 		}
 		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		return nil
+	}
+
+	if err := s.save(session, nil); err != nil {
+		return err
 	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
 	return nil
 }
 
@@ -201,12 +535,29 @@ func (s *RediStore) ping() (bool, error) {
 	return (data == "PONG"), nil
 }
 
-// save stores the session in redis.
-func (s *RediStore) save(session *sessions.Session) error {
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values,
-		s.Codecs...)
-	if err != nil {
-		return err
+// save stores the session in redis. When secret is non-nil, session.Values
+// is AES-GCM encrypted with it instead of going through s.Codecs, so that
+// reading the redis key alone (without the cookie) does not disclose it.
+func (s *RediStore) save(session *sessions.Session, secret []byte) error {
+	var encoded string
+	var err error
+	if secret != nil {
+		var plain []byte
+		if plain, err = s.serializer.Serialize(session); err != nil {
+			return err
+		}
+		if encoded, err = ticket.Encrypt(secret, plain); err != nil {
+			return err
+		}
+	} else {
+		var plain []byte
+		if plain, err = s.serializer.Serialize(session); err != nil {
+			return err
+		}
+		if encoded, err = securecookie.EncodeMulti(session.Name(), plain,
+			s.Codecs...); err != nil {
+			return err
+		}
 	}
 	if s.maxLength != 0 && len(encoded) > s.maxLength {
 		return errors.New("SessionStore: the value to store is too big")
@@ -222,28 +573,45 @@ func (s *RediStore) save(session *sessions.Session) error {
 	} else {
 		_, err = s.Client.Set(s.keyPrefix+session.ID, encoded, time.Duration(age)*time.Second).Result()
 	}
+	if err == nil {
+		s.cacheStore(session.ID, encoded)
+	}
 	return err
 }
 
-// load reads the session from redis.
+// load reads the session from redis, preferring a replica (see
+// RediStore.readClient) over the master when any are configured.
 // returns true if there is a sessoin data in DB
-func (s *RediStore) load(session *sessions.Session) error {
+func (s *RediStore) load(session *sessions.Session, secret []byte) error {
 	var err error
-	var data string
-	if s.IsCluster {
-		data, err = s.ClusterClient.Get(s.keyPrefix + session.ID).Result()
-	} else {
-		data, err = s.Client.Get(s.keyPrefix + session.ID).Result()
+	data, cached := s.cacheGet(session.ID)
+	if !cached {
+		if s.IsCluster {
+			data, err = s.ClusterClient.Get(s.keyPrefix + session.ID).Result()
+		} else {
+			data, err = s.readClient().Get(s.keyPrefix + session.ID).Result()
+		}
+		if err == nil {
+			s.cacheStore(session.ID, data)
+		}
 	}
 	if data == "" {
 		return nil // no data was associated with this key
 	}
+	if secret != nil {
+		plain, err := ticket.Decrypt(secret, data)
+		if err != nil {
+			return err
+		}
+		return s.serializer.Deserialize(plain, session)
+	}
 	// decode
+	var plain []byte
 	if err = securecookie.DecodeMulti(session.Name(), data,
-		&session.Values, s.Codecs...); err != nil {
+		&plain, s.Codecs...); err != nil {
 		return err
 	}
-	return nil
+	return s.serializer.Deserialize(plain, session)
 }
 
 // delete removes keys from redis if MaxAge<0
@@ -254,6 +622,8 @@ func (s *RediStore) delete(session *sessions.Session) error {
 	} else {
 		_, err = s.Client.Del(s.keyPrefix + session.ID).Result()
 	}
+	s.cacheDelete(session.ID)
+	s.secrets.Forget(session.ID)
 
 	return err
 }
@@ -0,0 +1,25 @@
+package redistore
+
+import (
+	"testing"
+
+	"github.com/miaomiao3/session/ticket"
+)
+
+// The AES-GCM encrypt/decrypt and Serializer round-trip tests now live in
+// ticket/ticket_test.go, since RediStore just delegates to that package.
+// This only checks the wiring: a RediStore holding ticket.GobSerializer, the
+// serializer the constructors set, has it swapped by SetSerializer. The store
+// is built by hand, so the constructors themselves (which need redis) are not
+// run.
+func TestRediStoreDefaultSerializer(t *testing.T) {
+	rs := &RediStore{serializer: ticket.GobSerializer{}}
+	if _, ok := rs.serializer.(ticket.GobSerializer); !ok {
+		t.Fatalf("default serializer = %T, want ticket.GobSerializer", rs.serializer)
+	}
+
+	rs.SetSerializer(ticket.JSONSerializer{})
+	if _, ok := rs.serializer.(ticket.JSONSerializer); !ok {
+		t.Fatalf("serializer after SetSerializer = %T, want ticket.JSONSerializer", rs.serializer)
+	}
+}
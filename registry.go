@@ -0,0 +1,39 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Factory builds a Store from a provider-specific JSON configuration blob.
+type Factory func(config json.RawMessage) (Store, error)
+
+var providers = make(map[string]Factory)
+
+// Register makes a session store provider available under name. It is meant
+// to be called from a provider package's init(), e.g.
+//
+//	import _ "github.com/miaomiao3/session/memcache"
+//
+// Register panics if called twice for the same name or if factory is nil.
+func Register(name string, factory Factory) {
+	if factory == nil {
+		panic("sessions: Register factory is nil")
+	}
+	if _, dup := providers[name]; dup {
+		panic("sessions: Register called twice for provider " + name)
+	}
+	providers[name] = factory
+}
+
+// NewManager builds a Store for the named provider, passing it config
+// unparsed. The provider must already be registered, normally by blank
+// importing its package. This mirrors beego's session.NewManager pattern,
+// e.g. sessions.NewManager("memcache", cfg) or sessions.NewManager("mysql", cfg).
+func NewManager(name string, config json.RawMessage) (Store, error) {
+	factory, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("sessions: unknown provider %q (forgot to import it?)", name)
+	}
+	return factory(config)
+}
@@ -45,12 +45,14 @@ func (s *Session) Get(key interface{}) interface{} {
 	return s.GetSession().Values[key]
 }
 
+// Set stores val under key. Like Delete, Clear and AddFlash, this only
+// marks the session dirty — the store isn't written to until Save runs,
+// normally once at the end of the request via SessionMiddware. This turns
+// a bulk update (e.g. merging a profile map) into a single store round
+// trip instead of one per key.
 func (s *Session) Set(key interface{}, val interface{}) {
-
 	s.GetSession().Values[key] = val
 	s.valueChanged = true
-	//save data if value changed
-	s.Save()
 }
 
 func (s *Session) Delete(key interface{}) {
@@ -97,6 +99,36 @@ func (s *Session) Save() error {
 	return nil
 }
 
+// RegenerateID deletes the current session under its old ID, assigns it a
+// fresh, random one and saves it right away, re-issuing the cookie. Call this
+// after login or any other privilege change: it is the standard fixation-
+// prevention primitive, and keeps an attacker who fixed a victim's
+// pre-auth session ID from inheriting the now-authenticated session.
+func (s *Session) RegenerateID() error {
+	session := s.GetSession()
+	if session.ID != "" {
+		oldOptions := session.Options
+		delOptions := *oldOptions
+		delOptions.MaxAge = -1
+		session.Options = &delOptions
+		err := session.Save(s.request, s.writer)
+		session.Options = oldOptions
+		if err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	s.valueChanged = true
+	return s.Save()
+}
+
+// Renew refreshes the session's TTL in the store and the cookie's Max-Age,
+// without otherwise changing its data. Unlike Save, it writes even if
+// nothing was marked dirty.
+func (s *Session) Renew() error {
+	return s.GetSession().Save(s.request, s.writer)
+}
+
 // Session returns a session with a specified name
 func (s *Session) GetSession() *sessions.Session {
 	if s.session == nil {
@@ -115,6 +147,12 @@ func SessionMiddware(name string, store Store) gin.HandlerFunc {
 		s := &Session{name, c.Request, store, nil, false, c.Writer}
 		c.Set(DefaultKey, s)
 		defer context.Clear(c.Request)
+		defer func() {
+			// Flush once per request instead of on every Set/Delete/Clear.
+			if err := s.Save(); err != nil {
+				log.Printf(errorFormat, err)
+			}
+		}()
 		c.Next()
 	}
 }
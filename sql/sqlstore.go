@@ -0,0 +1,266 @@
+// Package sqlstore stores sessions in a SQL database via database/sql.
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	_ "github.com/lib/pq"
+	"github.com/miaomiao3/session"
+)
+
+func init() {
+	sessions.Register("mysql", newFactory("mysql"))
+	sessions.Register("postgres", newFactory("postgres"))
+}
+
+func newFactory(driver string) sessions.Factory {
+	return func(config json.RawMessage) (sessions.Store, error) {
+		var cfg Config
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, err
+		}
+		cfg.Driver = driver
+		return NewSQLStore(cfg)
+	}
+}
+
+// createTableStmt, keyed by driver name. Postgres has no BLOB type, so it
+// uses BYTEA; MySQL stores data as BLOB.
+var createTableStmt = map[string]string{
+	"mysql": `CREATE TABLE IF NOT EXISTS sessions (
+		sid VARCHAR(255) PRIMARY KEY,
+		data BLOB,
+		expires TIMESTAMP NOT NULL
+	)`,
+	"postgres": `CREATE TABLE IF NOT EXISTS sessions (
+		sid VARCHAR(255) PRIMARY KEY,
+		data BYTEA,
+		expires TIMESTAMP NOT NULL
+	)`,
+}
+
+// Config configures a SQLStore, decoded from the JSON blob passed to
+// sessions.NewManager("mysql", cfg) or sessions.NewManager("postgres", cfg).
+type Config struct {
+	Driver     string   `json:"-"` // set by the registered provider name, not user-supplied
+	DSN        string   `json:"dsn"`
+	MaxAge     int      `json:"maxAge"`
+	MaxLength  int      `json:"maxLength"`
+	GCInterval int      `json:"gcInterval"` // seconds between GC sweeps of expired rows; 0 disables GC
+	KeyPairs   [][]byte `json:"keyPairs"`
+}
+
+// SQLStore stores sessions in a SQL database. When built with a GCInterval
+// greater than 0, it also polls for and deletes expired rows in the
+// background.
+type SQLStore struct {
+	DB            *sql.DB
+	Codecs        []securecookie.Codec
+	DefaultMaxAge int
+	options       *gsessions.Options
+	maxLength     int
+	driver        string
+	stopGC        chan struct{}
+}
+
+// NewSQLStore opens db, creates the sessions table if it doesn't exist, and
+// starts a background GC goroutine when cfg.GCInterval > 0.
+func NewSQLStore(cfg Config) (*SQLStore, error) {
+	stmt, ok := createTableStmt[cfg.Driver]
+	if !ok {
+		return nil, errors.New("sqlstore: unsupported driver " + cfg.Driver)
+	}
+
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(stmt); err != nil {
+		return nil, err
+	}
+
+	maxLength := cfg.MaxLength
+	if maxLength == 0 {
+		maxLength = 4096
+	}
+	store := &SQLStore{
+		DB:     db,
+		Codecs: securecookie.CodecsFromPairs(cfg.KeyPairs...),
+		options: &gsessions.Options{
+			Path:   "/",
+			MaxAge: cfg.MaxAge,
+		},
+		DefaultMaxAge: 60 * 30, // 30 minutes seems like a reasonable default
+		maxLength:     maxLength,
+		driver:        cfg.Driver,
+	}
+
+	if cfg.GCInterval > 0 {
+		store.stopGC = make(chan struct{})
+		go store.gcLoop(time.Duration(cfg.GCInterval) * time.Second)
+	}
+
+	return store, nil
+}
+
+// Close stops the background GC goroutine, if any, and closes the database.
+func (s *SQLStore) Close() error {
+	if s.stopGC != nil {
+		close(s.stopGC)
+	}
+	return s.DB.Close()
+}
+
+func (s *SQLStore) gcLoop(interval time.Duration) {
+	query := "DELETE FROM sessions WHERE expires < " + placeholder(s.driver, 1)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.DB.Exec(query, time.Now()); err != nil {
+				log.Printf("sqlstore: gc: %v\n", err)
+			}
+		case <-s.stopGC:
+			return
+		}
+	}
+}
+
+// Options sets the configuration for a session.
+func (s *SQLStore) Options(options sessions.Options) {
+	s.options = &gsessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *SQLStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *SQLStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	var err error
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			err = s.load(session)
+			session.IsNew = !(err == nil)
+		}
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *SQLStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(session); err != nil {
+			return err
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// save upserts the session row and its expiry.
+func (s *SQLStore) save(session *gsessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(encoded) > s.maxLength {
+		return errors.New("sqlstore: the value to store is too big")
+	}
+
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	expires := time.Now().Add(time.Duration(age) * time.Second)
+
+	upsert := upsertStmt(s.driver)
+	_, err = s.DB.Exec(upsert, session.ID, []byte(encoded), expires)
+	return err
+}
+
+// placeholder returns the nth (1-indexed) bind parameter marker for driver.
+// lib/pq doesn't accept mysql's `?`, so postgres needs its own `$n` form.
+func placeholder(driver string, n int) string {
+	if driver == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// upsertStmt returns a driver-specific upsert statement for the sessions table.
+func upsertStmt(driver string) string {
+	switch driver {
+	case "postgres":
+		return `INSERT INTO sessions (sid, data, expires) VALUES ($1, $2, $3)
+			ON CONFLICT (sid) DO UPDATE SET data = excluded.data, expires = excluded.expires`
+	default: // mysql
+		return `INSERT INTO sessions (sid, data, expires) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE data = VALUES(data), expires = VALUES(expires)`
+	}
+}
+
+// load reads the session row from the database.
+func (s *SQLStore) load(session *gsessions.Session) error {
+	var data []byte
+	var expires time.Time
+	query := "SELECT data, expires FROM sessions WHERE sid = " + placeholder(s.driver, 1)
+	row := s.DB.QueryRow(query, session.ID)
+	if err := row.Scan(&data, &expires); err != nil {
+		if err == sql.ErrNoRows {
+			return nil // no data was associated with this key
+		}
+		return err
+	}
+	if expires.Before(time.Now()) {
+		return nil // expired, treat as no data
+	}
+	return securecookie.DecodeMulti(session.Name(), string(data), &session.Values, s.Codecs...)
+}
+
+// delete removes the session row.
+func (s *SQLStore) delete(session *gsessions.Session) error {
+	query := "DELETE FROM sessions WHERE sid = " + placeholder(s.driver, 1)
+	_, err := s.DB.Exec(query, session.ID)
+	return err
+}
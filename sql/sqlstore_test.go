@@ -0,0 +1,37 @@
+package sqlstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlaceholder(t *testing.T) {
+	if got := placeholder("postgres", 3); got != "$3" {
+		t.Fatalf("placeholder(postgres, 3) = %q, want %q", got, "$3")
+	}
+	if got := placeholder("mysql", 3); got != "?" {
+		t.Fatalf("placeholder(mysql, 3) = %q, want %q", got, "?")
+	}
+}
+
+func TestUpsertStmtUsesDriverPlaceholders(t *testing.T) {
+	postgres := upsertStmt("postgres")
+	for _, want := range []string{"$1", "$2", "$3", "ON CONFLICT"} {
+		if !strings.Contains(postgres, want) {
+			t.Fatalf("postgres upsert statement missing %q: %s", want, postgres)
+		}
+	}
+
+	mysql := upsertStmt("mysql")
+	for _, want := range []string{"?", "ON DUPLICATE KEY UPDATE"} {
+		if !strings.Contains(mysql, want) {
+			t.Fatalf("mysql upsert statement missing %q: %s", want, mysql)
+		}
+	}
+}
+
+func TestNewSQLStoreRejectsUnsupportedDriver(t *testing.T) {
+	if _, err := NewSQLStore(Config{Driver: "sqlite"}); err == nil {
+		t.Fatal("NewSQLStore succeeded with an unsupported driver")
+	}
+}
@@ -0,0 +1,196 @@
+// Package ticket implements the "ticket" session-encryption scheme shared by
+// the redis and mongo stores: the session ID plus a per-session AES-256 key
+// travel together in the (signed) cookie, while only the AES-GCM ciphertext
+// of session.Values is ever stored server-side. An attacker who only has
+// access to the backing store (Redis/MongoDB) cannot decrypt any session.
+package ticket
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// Ticket is what gets put in the cookie when ticket encryption is enabled.
+type Ticket struct {
+	ID     string
+	Secret string // base64-encoded AES-256 key
+}
+
+// Encrypt AES-GCM encrypts plaintext with secret and returns it base64-encoded.
+func Encrypt(secret, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(secret []byte, encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ticket: ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// Serializer turns a session's Values into bytes for storage and back. A
+// store defaults to GobSerializer; call its SetSerializer to use a
+// different one, e.g. JSONSerializer so a non-Go reader of the backing
+// store can parse the blob directly. Changing it on a store with existing
+// sessions means those sessions won't decode until they expire or are
+// re-saved.
+type Serializer interface {
+	Serialize(session *sessions.Session) ([]byte, error)
+	Deserialize(data []byte, session *sessions.Session) error
+}
+
+// GobSerializer is the default Serializer, backed by encoding/gob. Types
+// other than the predeclared ones must be registered with gob.Register
+// before they can round trip through session.Values.
+type GobSerializer struct{}
+
+func (GobSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values)
+}
+
+// JSONSerializer uses encoding/json instead of gob, so the stored blob can
+// be read by non-Go clients. It requires session.Values keys to be
+// strings, since JSON objects don't support anything else.
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	m := make(map[string]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("ticket: JSONSerializer requires string keys, got %T", k)
+		}
+		m[ks] = v
+	}
+	return json.Marshal(m)
+}
+
+func (JSONSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for k, v := range m {
+		session.Values[k] = v
+	}
+	return nil
+}
+
+// defaultSecretTTL bounds how long a secret left idle in a SecretStash is
+// kept around before being treated as abandoned (e.g. a request that
+// loaded a session and never saved it back). It has no bearing on active
+// sessions: every request re-stashes the secret it read out of the ticket
+// cookie before it does anything else, so the entry backing a session that
+// is actually in use is refreshed well within the TTL.
+const defaultSecretTTL = 5 * time.Minute
+
+type secretEntry struct {
+	secret  []byte
+	expires time.Time
+}
+
+// SecretStash holds the per-session AES key of in-flight ticket-mode
+// sessions, keyed by session ID.
+//
+// Unlike a consume-once hand-off, Get does not remove the entry: New and
+// Save both call Get/Stash for the same ID within a single request, and
+// concurrent requests carrying the same ticket cookie (two overlapping
+// calls from one browser tab, a prefetch racing the real request, ...)
+// must all see the same secret. If the first one to finish Save deleted
+// the entry, a second, concurrent request would find it gone, mint its
+// own random secret, and re-encrypt the session under a key nobody else
+// has — the next request to read back whatever ciphertext actually landed
+// in the store would then fail to decrypt and silently look like a brand
+// new session. Stash instead refreshes the entry's expiry in place, so the
+// secret for an ID stays stable for as long as it keeps being used.
+type SecretStash struct {
+	entries sync.Map // map[string]secretEntry
+}
+
+// NewSecretStash returns an empty SecretStash.
+func NewSecretStash() *SecretStash {
+	return &SecretStash{}
+}
+
+// Get returns the secret stashed for id, if any and not yet expired.
+func (s *SecretStash) Get(id string) ([]byte, bool) {
+	v, ok := s.entries.Load(id)
+	if !ok {
+		return nil, false
+	}
+	entry := v.(secretEntry)
+	if time.Now().After(entry.expires) {
+		s.entries.Delete(id)
+		return nil, false
+	}
+	return entry.secret, true
+}
+
+// Stash records secret for id, refreshing its expiry, and opportunistically
+// sweeps other entries that have already expired.
+func (s *SecretStash) Stash(id string, secret []byte) {
+	s.entries.Store(id, secretEntry{secret: secret, expires: time.Now().Add(defaultSecretTTL)})
+	s.sweep()
+}
+
+// Forget removes id's entry outright, e.g. when its session is deleted.
+func (s *SecretStash) Forget(id string) {
+	s.entries.Delete(id)
+}
+
+func (s *SecretStash) sweep() {
+	now := time.Now()
+	s.entries.Range(func(id, v interface{}) bool {
+		if now.After(v.(secretEntry).expires) {
+			s.entries.Delete(id)
+		}
+		return true
+	})
+}
@@ -0,0 +1,130 @@
+package ticket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	secret := securecookie.GenerateRandomKey(32)
+	plaintext := []byte("hello session")
+
+	encoded, err := Encrypt(secret, plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	decoded, err := Decrypt(secret, encoded)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(decoded) != string(plaintext) {
+		t.Fatalf("Decrypt = %q, want %q", decoded, plaintext)
+	}
+}
+
+func TestDecryptWrongSecret(t *testing.T) {
+	secret := securecookie.GenerateRandomKey(32)
+	other := securecookie.GenerateRandomKey(32)
+
+	encoded, err := Encrypt(secret, []byte("secret data"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if _, err := Decrypt(other, encoded); err == nil {
+		t.Fatal("Decrypt succeeded with the wrong secret")
+	}
+}
+
+func TestGobSerializerRoundTrip(t *testing.T) {
+	in := sessions.NewSession(nil, "test")
+	in.Values["user"] = "alice"
+	in.Values["admin"] = true
+
+	var ser GobSerializer
+	data, err := ser.Serialize(in)
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+
+	out := sessions.NewSession(nil, "test")
+	if err := ser.Deserialize(data, out); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if out.Values["user"] != "alice" || out.Values["admin"] != true {
+		t.Fatalf("Deserialize = %v, want user=alice admin=true", out.Values)
+	}
+}
+
+func TestJSONSerializerRoundTrip(t *testing.T) {
+	in := sessions.NewSession(nil, "test")
+	in.Values["user"] = "alice"
+
+	var ser JSONSerializer
+	data, err := ser.Serialize(in)
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+
+	out := sessions.NewSession(nil, "test")
+	if err := ser.Deserialize(data, out); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if out.Values["user"] != "alice" {
+		t.Fatalf("Deserialize = %v, want user=alice", out.Values)
+	}
+}
+
+func TestJSONSerializerRejectsNonStringKeys(t *testing.T) {
+	in := sessions.NewSession(nil, "test")
+	in.Values[42] = "not a string key"
+
+	var ser JSONSerializer
+	if _, err := ser.Serialize(in); err == nil {
+		t.Fatal("Serialize succeeded with a non-string key")
+	}
+}
+
+func TestSecretStashGetStashForget(t *testing.T) {
+	s := NewSecretStash()
+
+	if _, ok := s.Get("sess1"); ok {
+		t.Fatal("Get on empty stash returned ok=true")
+	}
+
+	secret := securecookie.GenerateRandomKey(32)
+	s.Stash("sess1", secret)
+
+	got, ok := s.Get("sess1")
+	if !ok {
+		t.Fatal("Get after Stash returned ok=false")
+	}
+	if string(got) != string(secret) {
+		t.Fatalf("Get = %x, want %x", got, secret)
+	}
+
+	// Get must not consume the entry: a second, concurrent reader needs to
+	// see the same secret.
+	got2, ok := s.Get("sess1")
+	if !ok || string(got2) != string(secret) {
+		t.Fatal("Get consumed the entry; a second Get should still find it")
+	}
+
+	s.Forget("sess1")
+	if _, ok := s.Get("sess1"); ok {
+		t.Fatal("Get after Forget returned ok=true")
+	}
+}
+
+func TestSecretStashExpires(t *testing.T) {
+	s := NewSecretStash()
+	secret := securecookie.GenerateRandomKey(32)
+	s.entries.Store("sess1", secretEntry{secret: secret, expires: time.Now().Add(-time.Second)})
+
+	if _, ok := s.Get("sess1"); ok {
+		t.Fatal("Get returned ok=true for an expired entry")
+	}
+}